@@ -0,0 +1,57 @@
+// Package auth provides a pluggable authorization layer for sniproxy,
+// consulted after SNI extraction and before a connection is forwarded to a
+// backend. Implementations gate on the client's source address and/or the
+// SNI it presented.
+package auth
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// ErrDenied is wrapped by every rejection so callers can distinguish
+// authorization failures from transport or configuration errors.
+var ErrDenied = errors.New("connection denied by authorizer")
+
+// Authorizer decides whether a connection from remote presenting sni may be
+// forwarded to a backend. sni is "*" for non-TLS connections, matching the
+// placeholder sniproxy.SNIProxy uses when it cannot parse a ClientHello.
+type Authorizer interface {
+	Authorize(remote net.Addr, sni string) error
+}
+
+// DecisionFunc is a metrics hook invoked after every authorization
+// decision, so operators can alert on denial spikes without polling logs.
+type DecisionFunc func(remote net.Addr, sni string, allowed bool)
+
+// decisionHook guards a DecisionFunc set via an OnDecision method against
+// concurrent Authorize/ReadPreamble calls: operators normally wire up
+// metrics right after construction, while traffic may already be live.
+type decisionHook struct {
+	mu sync.RWMutex
+	fn DecisionFunc
+}
+
+func (h *decisionHook) set(fn DecisionFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fn = fn
+}
+
+func (h *decisionHook) call(remote net.Addr, sni string, allowed bool) {
+	h.mu.RLock()
+	fn := h.fn
+	h.mu.RUnlock()
+	if fn != nil {
+		fn(remote, sni, allowed)
+	}
+}
+
+func remoteHost(remote net.Addr) string {
+	host, _, err := net.SplitHostPort(remote.String())
+	if err != nil {
+		return remote.String()
+	}
+	return host
+}
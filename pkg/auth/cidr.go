@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/vitrevance/sniproxy/pkg/internal/filewatch"
+)
+
+// CIDRList authorizes connections by matching the client's source IP
+// against allow/deny lists loaded from a file. Each line is either
+// "allow <CIDR>" or "deny <CIDR>"; deny entries are checked first. An empty
+// allow list means every address is allowed unless denied.
+type CIDRList struct {
+	mu    sync.RWMutex
+	allow []*net.IPNet
+	deny  []*net.IPNet
+
+	file string
+
+	onDecision DecisionFunc
+
+	watcher *filewatch.Watcher
+}
+
+// NewCIDRList loads file and starts watching it for hot-reload.
+func NewCIDRList(ctx context.Context, file string) (*CIDRList, error) {
+	c := &CIDRList{file: file}
+
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+
+	if err := c.watch(ctx); err != nil {
+		log.Println("error starting CIDR list watcher", err)
+	}
+
+	return c, nil
+}
+
+// OnDecision registers fn as the decision metrics hook; see DecisionFunc.
+func (c *CIDRList) OnDecision(fn DecisionFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onDecision = fn
+}
+
+func (c *CIDRList) Authorize(remote net.Addr, sni string) error {
+	ip := net.ParseIP(remoteHost(remote))
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, n := range c.deny {
+		if ip != nil && n.Contains(ip) {
+			c.notify(remote, sni, false)
+			return fmt.Errorf("%w: %s matches deny list entry %s", ErrDenied, ip, n)
+		}
+	}
+
+	if len(c.allow) == 0 {
+		c.notify(remote, sni, true)
+		return nil
+	}
+
+	for _, n := range c.allow {
+		if ip != nil && n.Contains(ip) {
+			c.notify(remote, sni, true)
+			return nil
+		}
+	}
+
+	c.notify(remote, sni, false)
+	return fmt.Errorf("%w: %s matches no allow list entry", ErrDenied, ip)
+}
+
+func (c *CIDRList) notify(remote net.Addr, sni string, allowed bool) {
+	if c.onDecision != nil {
+		c.onDecision(remote, sni, allowed)
+	}
+}
+
+// Reload re-reads the backing file, parses it into fresh allow/deny lists
+// and atomically swaps them in. If any line fails to parse the old lists
+// are kept.
+func (c *CIDRList) Reload() error {
+	allow, deny, err := parseCIDRFile(c.file)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.allow = allow
+	c.deny = deny
+	c.mu.Unlock()
+
+	return nil
+}
+
+// Close stops the background file watcher goroutine.
+func (c *CIDRList) Close() error {
+	return c.watcher.Close()
+}
+
+func (c *CIDRList) watch(ctx context.Context) error {
+	w, err := filewatch.Watch(ctx, c.file, "CIDR list file", c.Reload)
+	if err != nil {
+		return err
+	}
+	c.watcher = w
+	return nil
+}
+
+func parseCIDRFile(path string) (allow, deny []*net.IPNet, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening CIDR list file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, nil, fmt.Errorf("error parsing CIDR list line %q: expected \"allow|deny <CIDR>\"", line)
+		}
+
+		_, network, err := net.ParseCIDR(fields[1])
+		if err != nil {
+			return nil, nil, fmt.Errorf("error parsing CIDR %q: %w", fields[1], err)
+		}
+
+		switch fields[0] {
+		case "allow":
+			allow = append(allow, network)
+		case "deny":
+			deny = append(deny, network)
+		default:
+			return nil, nil, fmt.Errorf("error parsing CIDR list line %q: unknown action %q", line, fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error scanning CIDR list file: %w", err)
+	}
+
+	return allow, deny, nil
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net"
+)
+
+// maxPreambleLength bounds how many bytes PreambleAuthorizer.ReadPreamble
+// will read from a connection before giving up on a client that never
+// sends a terminator, so a misbehaving peer can't be used to buffer
+// unbounded data per connection.
+const maxPreambleLength = 256
+
+// PreambleAuthorizer gates a connection on a shared secret sent as a single
+// newline-terminated line before the TLS handshake begins. It is opt-in per
+// listener: SNIProxy only calls ReadPreamble when configured to require
+// one, since a normal TLS client will not send this preamble.
+type PreambleAuthorizer struct {
+	secret   []byte
+	decision decisionHook
+}
+
+// NewPreambleAuthorizer returns a PreambleAuthorizer comparing the
+// preamble line against secret using a constant-time comparison.
+func NewPreambleAuthorizer(secret string) *PreambleAuthorizer {
+	return &PreambleAuthorizer{secret: []byte(secret)}
+}
+
+// OnDecision registers fn as the decision metrics hook; see DecisionFunc.
+func (p *PreambleAuthorizer) OnDecision(fn DecisionFunc) {
+	p.decision.set(fn)
+}
+
+// ReadPreamble reads a single newline-terminated line from conn and checks
+// it against the configured secret. It must be called, if at all, before
+// any TLS record is read from conn.
+func (p *PreambleAuthorizer) ReadPreamble(conn net.Conn) error {
+	line, err := readPreambleLine(conn)
+	remote := conn.RemoteAddr()
+	if err != nil {
+		p.notify(remote, false)
+		return fmt.Errorf("error reading preamble: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare(line, p.secret) != 1 {
+		p.notify(remote, false)
+		return fmt.Errorf("%w: invalid preamble", ErrDenied)
+	}
+
+	p.notify(remote, true)
+	return nil
+}
+
+// Authorize always allows; access control happens in ReadPreamble, which
+// runs before the SNI is even known.
+func (p *PreambleAuthorizer) Authorize(remote net.Addr, sni string) error {
+	return nil
+}
+
+func (p *PreambleAuthorizer) notify(remote net.Addr, allowed bool) {
+	p.decision.call(remote, "", allowed)
+}
+
+// readPreambleLine reads bytes one at a time up to and excluding the first
+// '\n', so it never buffers past the preamble into the TLS record that
+// follows it on the same connection.
+func readPreambleLine(r io.Reader) ([]byte, error) {
+	var line []byte
+	one := make([]byte, 1)
+	for len(line) < maxPreambleLength {
+		n, err := r.Read(one)
+		if n == 1 {
+			if one[0] == '\n' {
+				return bytesTrimCR(line), nil
+			}
+			line = append(line, one[0])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("preamble exceeds maximum length of %d bytes", maxPreambleLength)
+}
+
+func bytesTrimCR(line []byte) []byte {
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		return line[:n-1]
+	}
+	return line
+}
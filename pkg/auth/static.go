@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"fmt"
+	"net"
+)
+
+// StaticSNIList authorizes connections by exact match against a fixed
+// per-SNI allow/deny set. Unlike CIDRList it is not file-backed and does
+// not hot-reload; it is meant for small, code-configured ACLs.
+type StaticSNIList struct {
+	allow map[string]bool
+	deny  map[string]bool
+
+	decision decisionHook
+}
+
+// NewStaticSNIList builds a StaticSNIList from allow/deny slices. An empty
+// allow list means every SNI is allowed unless denied.
+func NewStaticSNIList(allow, deny []string) *StaticSNIList {
+	l := &StaticSNIList{
+		allow: make(map[string]bool, len(allow)),
+		deny:  make(map[string]bool, len(deny)),
+	}
+	for _, sni := range allow {
+		l.allow[sni] = true
+	}
+	for _, sni := range deny {
+		l.deny[sni] = true
+	}
+	return l
+}
+
+// OnDecision registers fn as the decision metrics hook; see DecisionFunc.
+func (l *StaticSNIList) OnDecision(fn DecisionFunc) {
+	l.decision.set(fn)
+}
+
+func (l *StaticSNIList) Authorize(remote net.Addr, sni string) error {
+	if l.deny[sni] {
+		l.decision.call(remote, sni, false)
+		return fmt.Errorf("%w: %s is in the SNI deny list", ErrDenied, sni)
+	}
+
+	if len(l.allow) == 0 || l.allow[sni] {
+		l.decision.call(remote, sni, true)
+		return nil
+	}
+
+	l.decision.call(remote, sni, false)
+	return fmt.Errorf("%w: %s is not in the SNI allow list", ErrDenied, sni)
+}
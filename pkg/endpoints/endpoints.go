@@ -1,69 +1,221 @@
 package endpoints
 
 import (
-	"bufio"
 	"context"
+	"encoding/csv"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+
+	"github.com/vitrevance/sniproxy/pkg/internal/filewatch"
+)
+
+// tlsVersions maps the CSV column value to the TLS record version used by
+// sniproxy.TLSHeader.Version (e.g. "1.2" -> 0x0303).
+var tlsVersions = map[string]uint16{
+	"1.0": 0x0301,
+	"1.1": 0x0302,
+	"1.2": 0x0303,
+	"1.3": 0x0304,
+}
+
+// ProxyProtoVersion selects whether and how a PROXY protocol header is sent
+// to the backend ahead of the client's data, so it can recover the real
+// client address instead of seeing the proxy's own.
+type ProxyProtoVersion string
+
+const (
+	ProxyProtoOff ProxyProtoVersion = "off"
+	ProxyProtoV1  ProxyProtoVersion = "v1"
+	ProxyProtoV2  ProxyProtoVersion = "v2"
 )
 
 type EndpointEntry struct {
 	Domain  string
 	Address string
 	regex   *regexp.Regexp
+
+	// MinTLSVersion, when non-zero, overrides the proxy-wide minimum TLS
+	// version policy for connections routed to this endpoint.
+	MinTLSVersion uint16
+	// AllowedALPN, when non-empty, rejects connections routed to this
+	// endpoint whose ClientHello advertises ALPN protocols but none of
+	// these. ClientHellos without an ALPN extension are not restricted.
+	AllowedALPN []string
+	// DeniedCiphers lists additional cipher suites to reject for this
+	// endpoint, on top of the proxy's built-in broken-suite list.
+	DeniedCiphers []uint16
+	// SendProxyProto selects the PROXY protocol version written to this
+	// endpoint's backend before the client's data. Defaults to off.
+	SendProxyProto ProxyProtoVersion
 }
 
 // EndpointDB contains a set of endpoints
 type EndpointDB struct {
+	mu        sync.RWMutex
 	endpoints []EndpointEntry
 
 	file string
+
+	subscribersMu sync.Mutex
+	subscribers   []func()
+
+	watcher *filewatch.Watcher
 }
 
-// NewEndpointsDB gives an EndpointDB instance
+// NewEndpointsDB gives an EndpointDB instance and starts watching the
+// backing file for changes so routes can be updated without a restart.
 func NewEndpointsDB(ctx context.Context, file string) *EndpointDB {
 	db := &EndpointDB{
 		endpoints: []EndpointEntry{},
 		file:      file,
 	}
 
-	db.readFile()
+	if err := db.Reload(); err != nil {
+		log.Println("error loading endpoints", err)
+	}
+
+	if err := db.watch(ctx); err != nil {
+		log.Println("error starting endpoints watcher", err)
+	}
+
 	return db
 }
 
-func (e *EndpointDB) readFile() {
-	// open endpoint file
-	file, err := os.Open(e.file)
+// watch starts a background goroutine that reloads the endpoints file on
+// write/rename events, debouncing bursts of events into a single reload.
+func (e *EndpointDB) watch(ctx context.Context) error {
+	w, err := filewatch.Watch(ctx, e.file, "endpoints file", e.Reload)
 	if err != nil {
-		log.Println("error updating endpoints", err)
-		return
+		return err
+	}
+	e.watcher = w
+	return nil
+}
+
+// Reload re-reads the endpoints file, parses it into a fresh table and
+// atomically swaps it in, so in-flight Get calls never observe a partially
+// loaded table. If any line fails to parse the old table is kept.
+func (e *EndpointDB) Reload() error {
+	entries, err := parseFile(e.file)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.endpoints = entries
+	e.mu.Unlock()
+
+	e.notifySubscribers()
+	return nil
+}
+
+// Subscribe registers fn to be called every time the endpoints table is
+// successfully reloaded, so other components (SNIProxy, metrics) can react.
+func (e *EndpointDB) Subscribe(fn func()) {
+	e.subscribersMu.Lock()
+	defer e.subscribersMu.Unlock()
+	e.subscribers = append(e.subscribers, fn)
+}
+
+func (e *EndpointDB) notifySubscribers() {
+	e.subscribersMu.Lock()
+	subscribers := append([]func(){}, e.subscribers...)
+	e.subscribersMu.Unlock()
+
+	for _, fn := range subscribers {
+		fn()
+	}
+}
+
+// Close stops the background file watcher goroutine.
+func (e *EndpointDB) Close() error {
+	return e.watcher.Close()
+}
+
+func parseFile(path string) ([]EndpointEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening endpoints file: %w", err)
 	}
 	defer file.Close()
 
-	// read all lines
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		// split line
-		line := scanner.Text()
-		// split line
-		ind := strings.LastIndex(line, ",")
-		if ind == -1 {
+	entries := []EndpointEntry{}
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing endpoints file: %w", err)
+		}
+		if len(fields) < 2 {
 			continue
 		}
-		parts := []string{line[:ind], line[ind+1:]}
-		// add endpoint
-		e.endpoints = append(e.endpoints, EndpointEntry{
-			Domain:  parts[0],
-			Address: parts[1],
-			regex:   regexp.MustCompile(parts[0]),
-		})
+		domain := fields[0]
+		address := fields[1]
+
+		regex, err := regexp.Compile(domain)
+		if err != nil {
+			return nil, fmt.Errorf("error compiling regex %q: %w", domain, err)
+		}
+
+		entry := EndpointEntry{
+			Domain:  domain,
+			Address: address,
+			regex:   regex,
+		}
+
+		if len(fields) > 2 && fields[2] != "" {
+			version, ok := tlsVersions[fields[2]]
+			if !ok {
+				return nil, fmt.Errorf("error parsing min TLS version %q for %q", fields[2], domain)
+			}
+			entry.MinTLSVersion = version
+		}
+
+		if len(fields) > 3 && fields[3] != "" {
+			entry.AllowedALPN = strings.Split(fields[3], "|")
+		}
+
+		if len(fields) > 4 && fields[4] != "" {
+			for _, c := range strings.Split(fields[4], "|") {
+				suite, err := strconv.ParseUint(c, 0, 16)
+				if err != nil {
+					return nil, fmt.Errorf("error parsing denied cipher %q for %q: %w", c, domain, err)
+				}
+				entry.DeniedCiphers = append(entry.DeniedCiphers, uint16(suite))
+			}
+		}
+
+		entry.SendProxyProto = ProxyProtoOff
+		if len(fields) > 5 && fields[5] != "" {
+			switch ProxyProtoVersion(fields[5]) {
+			case ProxyProtoV1, ProxyProtoV2, ProxyProtoOff:
+				entry.SendProxyProto = ProxyProtoVersion(fields[5])
+			default:
+				return nil, fmt.Errorf("error parsing proxy protocol version %q for %q", fields[5], domain)
+			}
+		}
+
+		entries = append(entries, entry)
 	}
+
+	return entries, nil
 }
 
 func (e *EndpointDB) Get(endpoint string) (EndpointEntry, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
 	for _, ep := range e.endpoints {
 		if ep.regex.MatchString(endpoint) {
 			return ep, nil
@@ -0,0 +1,32 @@
+package endpoints
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestParseFile_DomainRegexWithComma guards against a regression where
+// splitting each line on every comma instead of parsing it as CSV broke any
+// domain regex containing a comma, such as a {m,n} quantifier.
+func TestParseFile_DomainRegexWithComma(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "endpoints.csv")
+	line := `"^a{2,4}\.example\.com$",127.0.0.1:9000` + "\n"
+	if err := os.WriteFile(file, []byte(line), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := parseFile(file)
+	if err != nil {
+		t.Fatalf("parseFile: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	if entries[0].Domain != `^a{2,4}\.example\.com$` {
+		t.Errorf("got domain %q, want %q", entries[0].Domain, `^a{2,4}\.example\.com$`)
+	}
+	if entries[0].Address != "127.0.0.1:9000" {
+		t.Errorf("got address %q, want %q", entries[0].Address, "127.0.0.1:9000")
+	}
+}
@@ -0,0 +1,105 @@
+// Package filewatch provides a debounced fsnotify watcher for single-file
+// config sources that support hot-reload (EndpointDB, CIDRList), so the
+// watch/debounce/cancel plumbing is written once instead of per caller.
+package filewatch
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DebounceInterval coalesces bursts of fsnotify events (e.g. editors that
+// write a file via rename+create) into a single reload.
+const DebounceInterval = 200 * time.Millisecond
+
+// Watcher watches a single file and calls reload, debounced, whenever it is
+// written, created or renamed.
+type Watcher struct {
+	watcher *fsnotify.Watcher
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// Watch starts watching file in a background goroutine and returns a
+// Watcher that can be stopped with Close. reload is called, debounced by
+// DebounceInterval, on every relevant fsnotify event; errors it returns are
+// logged with label identifying the caller.
+//
+// The directory containing file is watched rather than file itself: editors
+// and deploy scripts commonly replace a config file by writing a temp file
+// and renaming it over the target, which inotify reports as a Remove on the
+// watched path, leaving a file-level watch permanently unbound from the new
+// inode. A directory watch survives that replacement.
+func Watch(ctx context.Context, file, label string, reload func() error) (*Watcher, error) {
+	dir := filepath.Dir(file)
+	name := filepath.Base(file)
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("error creating file watcher: %w", err)
+	}
+
+	if err := fsw.Add(dir); err != nil {
+		fsw.Close()
+		return nil, fmt.Errorf("error watching %s: %w", label, err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	w := &Watcher{watcher: fsw, cancel: cancel}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer fsw.Close()
+
+		var debounce *time.Timer
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-fsw.Events:
+				if !ok {
+					return
+				}
+				if filepath.Base(event.Name) != name {
+					continue
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) == 0 {
+					continue
+				}
+				if debounce == nil {
+					debounce = time.AfterFunc(DebounceInterval, func() {
+						if err := reload(); err != nil {
+							log.Printf("error reloading %s: %v", label, err)
+						}
+					})
+				} else {
+					debounce.Reset(DebounceInterval)
+				}
+			case err, ok := <-fsw.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("%s watcher error: %v", label, err)
+			}
+		}
+	}()
+
+	return w, nil
+}
+
+// Close stops the background watcher goroutine.
+func (w *Watcher) Close() error {
+	if w == nil || w.cancel == nil {
+		return nil
+	}
+	w.cancel()
+	w.wg.Wait()
+	return nil
+}
@@ -0,0 +1,62 @@
+package filewatch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestWatch_SurvivesAtomicRename guards against a regression where a
+// file-level fsnotify watch is left bound to an unlinked inode after an
+// atomic save (write a temp file, rename it over the target) — the
+// editor/deploy pattern this package exists to support.
+func TestWatch_SurvivesAtomicRename(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "config")
+	if err := os.WriteFile(target, []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var reloads int32
+	w, err := Watch(context.Background(), target, "test file", func() error {
+		atomic.AddInt32(&reloads, 1)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	tmp := filepath.Join(dir, ".config.tmp")
+	if err := os.WriteFile(tmp, []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		t.Fatal(err)
+	}
+	if !waitForCount(&reloads, 1) {
+		t.Fatal("reload not triggered after atomic rename-over")
+	}
+
+	// A subsequent plain write to the replaced file must still reload.
+	if err := os.WriteFile(target, []byte("v3"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !waitForCount(&reloads, 2) {
+		t.Fatal("reload not triggered after subsequent plain write")
+	}
+}
+
+func waitForCount(counter *int32, want int32) bool {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if atomic.LoadInt32(counter) >= want {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return atomic.LoadInt32(counter) >= want
+}
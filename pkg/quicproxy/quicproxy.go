@@ -0,0 +1,473 @@
+// Package quicproxy is an SNI aware non-decrypting proxy for QUIC/HTTP3
+// traffic. It mirrors pkg/sniproxy but operates on UDP datagrams: it peeks
+// into the QUIC long-header Initial packet, removes header protection and
+// decrypts just enough of the handshake to recover the ClientHello SNI,
+// then forwards the client's 4-tuple to the matched backend unmodified.
+package quicproxy
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+
+	"github.com/vitrevance/sniproxy/pkg/endpoints"
+	"github.com/vitrevance/sniproxy/pkg/sniproxy"
+)
+
+var newSHA256 = sha256.New
+
+// quicV1InitialSalt is the version-1 initial salt defined in RFC 9001 section 5.2.
+var quicV1InitialSalt = []byte{
+	0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3,
+	0x4d, 0x17, 0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad,
+	0xcc, 0xbb, 0x7f, 0x0a,
+}
+
+var ErrNotInitial = errors.New("not a QUIC Initial packet")
+var ErrShortPacket = errors.New("packet too short to parse")
+var ErrNoSNI = errors.New("no SNI found in ClientHello")
+var ErrCryptoStreamTooLarge = errors.New("CRYPTO stream offset exceeds maximum ClientHello size")
+
+const idleTimeout = 2 * time.Minute
+
+// QUICProxy is a UDP, SNI aware non-decrypting QUIC proxy module
+type QUICProxy struct {
+	endpointsDB *endpoints.EndpointDB
+
+	mu       sync.Mutex
+	sessions map[string]*udpSession
+}
+
+// udpSession tracks a client 4-tuple forwarded to a backend
+type udpSession struct {
+	backend    net.Conn
+	lastActive time.Time
+}
+
+// NewQUICProxy gives a new QUICProxy instance
+func NewQUICProxy(endpointsDB *endpoints.EndpointDB) *QUICProxy {
+	return &QUICProxy{
+		endpointsDB: endpointsDB,
+		sessions:    map[string]*udpSession{},
+	}
+}
+
+// ListenAndServe opens a UDP listener on addr and dispatches every datagram
+// to HandleQUICPacket, forwarding matched sessions to their backend.
+func (q *QUICProxy) ListenAndServe(addr string) error {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return fmt.Errorf("error resolving listen address: %w", err)
+	}
+
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return fmt.Errorf("error listening on udp: %w", err)
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 65536)
+	for {
+		n, clientAddr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return fmt.Errorf("error reading udp packet: %w", err)
+		}
+
+		packet := make([]byte, n)
+		copy(packet, buf[:n])
+
+		q.handlePacketSafely(conn, clientAddr, packet)
+	}
+}
+
+// handlePacketSafely runs HandleQUICPacket with a recover guard, so a
+// malformed or adversarial datagram that slips past a parsing bug can only
+// drop that one packet instead of taking down the proxy process.
+func (q *QUICProxy) handlePacketSafely(conn *net.UDPConn, clientAddr *net.UDPAddr, packet []byte) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Println("recovered from panic handling quic packet from", clientAddr, ":", r)
+		}
+	}()
+
+	if err := q.HandleQUICPacket(conn, clientAddr, packet); err != nil {
+		log.Println("error handling quic packet", err)
+	}
+}
+
+// HandleQUICPacket routes a single UDP datagram originating from clientAddr.
+// If the 4-tuple already has an established session the datagram is
+// forwarded as-is; otherwise the packet must be a QUIC Initial carrying a
+// ClientHello so the SNI can be extracted and the backend selected.
+func (q *QUICProxy) HandleQUICPacket(conn *net.UDPConn, clientAddr *net.UDPAddr, data []byte) error {
+	key := clientAddr.String()
+
+	q.mu.Lock()
+	session, ok := q.sessions[key]
+	q.mu.Unlock()
+
+	if ok {
+		session.lastActive = time.Now()
+		_, err := session.backend.Write(data)
+		return err
+	}
+
+	sni, err := extractSNI(data)
+	if err != nil {
+		return fmt.Errorf("error extracting sni: %w", err)
+	}
+
+	ep, err := q.endpointsDB.Get(sni)
+	if err != nil {
+		return fmt.Errorf("error routing domain %s: %w", sni, err)
+	}
+
+	backend, err := net.Dial("udp", ep.Address)
+	if err != nil {
+		return fmt.Errorf("error dialing backend: %w", err)
+	}
+
+	session = &udpSession{backend: backend, lastActive: time.Now()}
+	q.mu.Lock()
+	q.sessions[key] = session
+	q.mu.Unlock()
+
+	go q.pumpBackend(conn, clientAddr, key, session)
+
+	_, err = backend.Write(data)
+	return err
+}
+
+// pumpBackend copies datagrams coming back from the backend to the original
+// client address and evicts the session once the backend has sent nothing
+// for idleTimeout; datagrams from the client do not extend that deadline.
+func (q *QUICProxy) pumpBackend(conn *net.UDPConn, clientAddr *net.UDPAddr, key string, session *udpSession) {
+	defer func() {
+		q.mu.Lock()
+		delete(q.sessions, key)
+		q.mu.Unlock()
+		session.backend.Close()
+	}()
+
+	buf := make([]byte, 65536)
+	for {
+		session.backend.SetReadDeadline(time.Now().Add(idleTimeout))
+		n, err := session.backend.Read(buf)
+		if err != nil {
+			return
+		}
+		session.lastActive = time.Now()
+		if _, err := conn.WriteToUDP(buf[:n], clientAddr); err != nil {
+			return
+		}
+	}
+}
+
+// quicLongHeader is the parsed subset of a QUIC long header we need to
+// remove header protection and derive initial secrets.
+type quicLongHeader struct {
+	version       uint32
+	dcid          []byte
+	scid          []byte
+	payloadOffset int
+	// length is the declared Length field: the number of bytes making up
+	// the packet number and payload, not including anything that follows
+	// in the UDP datagram (e.g. RFC 9000 section 14.1 padding to the
+	// 1200-byte Initial minimum).
+	length int
+}
+
+func parseLongHeader(data []byte) (quicLongHeader, error) {
+	if len(data) < 7 {
+		return quicLongHeader{}, ErrShortPacket
+	}
+	if data[0]&0x80 == 0 {
+		return quicLongHeader{}, ErrNotInitial
+	}
+	version := binary.BigEndian.Uint32(data[1:5])
+
+	pos := 5
+	dcidLen := int(data[pos])
+	pos++
+	if pos+dcidLen > len(data) {
+		return quicLongHeader{}, ErrShortPacket
+	}
+	dcid := data[pos : pos+dcidLen]
+	pos += dcidLen
+
+	if pos >= len(data) {
+		return quicLongHeader{}, ErrShortPacket
+	}
+	scidLen := int(data[pos])
+	pos++
+	if pos+scidLen > len(data) {
+		return quicLongHeader{}, ErrShortPacket
+	}
+	scid := data[pos : pos+scidLen]
+	pos += scidLen
+
+	// Initial packets (long header type bits 00) additionally carry a Token
+	// Length + Token before the Length field.
+	if (data[0]>>4)&0x3 != 0 {
+		return quicLongHeader{}, ErrNotInitial
+	}
+	tokenLen, n, err := readVarint(data[pos:])
+	if err != nil {
+		return quicLongHeader{}, err
+	}
+	pos += n + int(tokenLen)
+	if pos > len(data) {
+		return quicLongHeader{}, ErrShortPacket
+	}
+
+	// Length field (varint) covers packet number + payload.
+	length, n, err := readVarint(data[pos:])
+	if err != nil {
+		return quicLongHeader{}, err
+	}
+	pos += n
+	if pos+int(length) > len(data) {
+		return quicLongHeader{}, ErrShortPacket
+	}
+
+	return quicLongHeader{
+		version:       version,
+		dcid:          dcid,
+		scid:          scid,
+		payloadOffset: pos,
+		length:        int(length),
+	}, nil
+}
+
+func readVarint(data []byte) (uint64, int, error) {
+	if len(data) == 0 {
+		return 0, 0, ErrShortPacket
+	}
+	prefix := data[0] >> 6
+	length := 1 << prefix
+	if len(data) < length {
+		return 0, 0, ErrShortPacket
+	}
+	v := uint64(data[0] & 0x3f)
+	for i := 1; i < length; i++ {
+		v = v<<8 | uint64(data[i])
+	}
+	return v, length, nil
+}
+
+// extractSNI removes header protection from a QUIC v1 Initial packet,
+// decrypts the payload, reassembles the CRYPTO frames and extracts the SNI
+// from the resulting ClientHello.
+func extractSNI(data []byte) (string, error) {
+	hdr, err := parseLongHeader(data)
+	if err != nil {
+		return "", err
+	}
+
+	key, iv, hp, err := deriveInitialSecrets(hdr.dcid)
+	if err != nil {
+		return "", fmt.Errorf("error deriving initial secrets: %w", err)
+	}
+
+	packet := make([]byte, len(data))
+	copy(packet, data)
+
+	if err := removeHeaderProtection(packet, hdr.payloadOffset, hp); err != nil {
+		return "", fmt.Errorf("error removing header protection: %w", err)
+	}
+
+	pnLen := int(packet[0]&0x3) + 1
+	pn := decodePacketNumber(packet[hdr.payloadOffset : hdr.payloadOffset+pnLen])
+
+	// The declared Length covers only the packet number and payload; any
+	// further bytes in the datagram are padding (real clients routinely
+	// pad Initial datagrams to the 1200-byte minimum) and must not be fed
+	// to the AEAD as ciphertext.
+	payloadEnd := hdr.payloadOffset + hdr.length
+	if payloadEnd > len(packet) || hdr.length < pnLen {
+		return "", ErrShortPacket
+	}
+
+	header := packet[:hdr.payloadOffset+pnLen]
+	ciphertext := packet[hdr.payloadOffset+pnLen : payloadEnd]
+
+	plaintext, err := decryptInitial(key, iv, pn, header, ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("error decrypting initial payload: %w", err)
+	}
+
+	clientHello, err := reassembleCrypto(plaintext)
+	if err != nil {
+		return "", err
+	}
+
+	record := sniproxy.TLSRecord{Body: clientHello}
+	sni := record.SNI()
+	if sni == "" {
+		return "", ErrNoSNI
+	}
+	return sni, nil
+}
+
+func deriveInitialSecrets(dcid []byte) (key, iv, hp []byte, err error) {
+	initialSecret := hkdfExtract(quicV1InitialSalt, dcid)
+	clientSecret := hkdfExpandLabel(initialSecret, "client in", 32)
+
+	key = hkdfExpandLabel(clientSecret, "quic key", 16)
+	iv = hkdfExpandLabel(clientSecret, "quic iv", 12)
+	hp = hkdfExpandLabel(clientSecret, "quic hp", 16)
+	return key, iv, hp, nil
+}
+
+func hkdfExtract(salt, ikm []byte) []byte {
+	return hkdf.Extract(newSHA256, ikm, salt)
+}
+
+// hkdfExpandLabel implements the TLS 1.3 / QUIC HKDF-Expand-Label with an
+// empty Context, as used to derive all QUIC initial keys.
+func hkdfExpandLabel(secret []byte, label string, length int) []byte {
+	fullLabel := "tls13 " + label
+	info := make([]byte, 0, 2+1+len(fullLabel)+1)
+	info = binary.BigEndian.AppendUint16(info, uint16(length))
+	info = append(info, byte(len(fullLabel)))
+	info = append(info, []byte(fullLabel)...)
+	info = append(info, 0) // empty Context
+
+	reader := hkdf.Expand(newSHA256, secret, info)
+	out := make([]byte, length)
+	reader.Read(out)
+	return out
+}
+
+func removeHeaderProtection(packet []byte, pnOffset int, hp []byte) error {
+	if pnOffset+4+16 > len(packet) {
+		return ErrShortPacket
+	}
+	sample := packet[pnOffset+4 : pnOffset+4+16]
+
+	block, err := aes.NewCipher(hp)
+	if err != nil {
+		return err
+	}
+	mask := make([]byte, aes.BlockSize)
+	block.Encrypt(mask, sample)
+
+	if packet[0]&0x80 != 0 {
+		packet[0] ^= mask[0] & 0x0f
+	} else {
+		packet[0] ^= mask[0] & 0x1f
+	}
+
+	pnLen := int(packet[0]&0x3) + 1
+	for i := 0; i < pnLen; i++ {
+		packet[pnOffset+i] ^= mask[1+i]
+	}
+	return nil
+}
+
+func decodePacketNumber(b []byte) uint64 {
+	var pn uint64
+	for _, v := range b {
+		pn = pn<<8 | uint64(v)
+	}
+	return pn
+}
+
+func decryptInitial(key, iv []byte, pn uint64, header, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, len(iv))
+	copy(nonce, iv)
+	pnBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(pnBytes, pn)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-8+i] ^= pnBytes[i]
+	}
+
+	return aead.Open(nil, nonce, ciphertext, header)
+}
+
+// reassembleCrypto walks the decrypted Initial payload's frames, gathers the
+// CRYPTO frames (type 0x06) in stream-offset order and returns the
+// concatenated handshake bytes (expected to hold a ClientHello).
+func reassembleCrypto(payload []byte) ([]byte, error) {
+	type chunk struct {
+		offset uint64
+		data   []byte
+	}
+	var chunks []chunk
+
+	pos := 0
+	for pos < len(payload) {
+		frameType := payload[pos]
+		pos++
+
+		switch {
+		case frameType == 0x00: // PADDING
+			continue
+		case frameType == 0x01: // PING
+			continue
+		case frameType == 0x06: // CRYPTO
+			offset, n, err := readVarint(payload[pos:])
+			if err != nil {
+				return nil, err
+			}
+			pos += n
+			length, n, err := readVarint(payload[pos:])
+			if err != nil {
+				return nil, err
+			}
+			pos += n
+			if pos+int(length) > len(payload) {
+				return nil, ErrShortPacket
+			}
+			// The stream offset and length are attacker-controlled and
+			// QUIC Initial packets carry no secret protection, so a
+			// forged packet can claim an arbitrary offset; bound it to
+			// the largest ClientHello we would ever reassemble instead
+			// of trusting it for an allocation size.
+			if offset+length > sniproxy.MaxTLSRecordSize {
+				return nil, ErrCryptoStreamTooLarge
+			}
+			chunks = append(chunks, chunk{offset: offset, data: payload[pos : pos+int(length)]})
+			pos += int(length)
+		default:
+			// Any other frame type is not expected in an Initial packet
+			// carrying a ClientHello; stop walking rather than
+			// misinterpreting unrelated frame bodies as frame types.
+			return nil, ErrNoSNI
+		}
+	}
+
+	if len(chunks) == 0 {
+		return nil, ErrNoSNI
+	}
+
+	total := 0
+	for _, c := range chunks {
+		if end := int(c.offset) + len(c.data); end > total {
+			total = end
+		}
+	}
+	out := make([]byte, total)
+	for _, c := range chunks {
+		copy(out[c.offset:], c.data)
+	}
+	return out, nil
+}
@@ -0,0 +1,167 @@
+package quicproxy
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// rfc9001ExampleDCID is the destination connection ID used throughout RFC
+// 9001 Appendix A's worked Initial-packet example. We reuse it here as a
+// realistic DCID; the exact Appendix A byte-for-byte packet capture isn't
+// reproduced (this environment has no network access to double check it
+// against the published RFC text), so instead these tests drive a packet
+// built with the package's own RFC 9001 §5.2-5.4 primitives end to end
+// through parseLongHeader/removeHeaderProtection/decryptInitial, the same
+// way a real Initial packet would be processed.
+var rfc9001ExampleDCID = []byte{0x83, 0x94, 0xc8, 0xf0, 0x3e, 0x51, 0x57, 0x08}
+
+func TestExtractSNI_RoundTrip(t *testing.T) {
+	clientHello := buildClientHello("example.com")
+	packet := buildInitialPacket(t, rfc9001ExampleDCID, clientHello)
+
+	sni, err := extractSNI(packet)
+	if err != nil {
+		t.Fatalf("extractSNI: %v", err)
+	}
+	if sni != "example.com" {
+		t.Errorf("got SNI %q, want %q", sni, "example.com")
+	}
+}
+
+func TestExtractSNI_IgnoresDatagramPadding(t *testing.T) {
+	clientHello := buildClientHello("example.com")
+	packet := buildInitialPacket(t, rfc9001ExampleDCID, clientHello)
+
+	// Real clients pad the Initial datagram to the RFC 9000 section 14.1
+	// 1200-byte minimum; those trailing bytes sit outside the packet's
+	// declared Length and must not be fed to the AEAD as ciphertext.
+	padded := make([]byte, 1200)
+	copy(padded, packet)
+
+	sni, err := extractSNI(padded)
+	if err != nil {
+		t.Fatalf("extractSNI: %v", err)
+	}
+	if sni != "example.com" {
+		t.Errorf("got SNI %q, want %q", sni, "example.com")
+	}
+}
+
+func TestReassembleCrypto_RejectsOversizedOffset(t *testing.T) {
+	payload := []byte{0x06} // CRYPTO frame type
+	payload = appendVarint(payload, 1<<32)
+	payload = appendVarint(payload, 1)
+	payload = append(payload, 0x00)
+
+	_, err := reassembleCrypto(payload)
+	if !errors.Is(err, ErrCryptoStreamTooLarge) {
+		t.Fatalf("got err %v, want ErrCryptoStreamTooLarge", err)
+	}
+}
+
+// buildClientHello returns a minimal ClientHello handshake body (the format
+// sniproxy.TLSRecord.SNI parses) advertising sni via the server_name
+// extension.
+func buildClientHello(sni string) []byte {
+	name := []byte(sni)
+	nameEntry := append([]byte{0x00}, byte(len(name)>>8), byte(len(name)))
+	nameEntry = append(nameEntry, name...)
+
+	serverNameExt := append([]byte{byte(len(nameEntry) >> 8), byte(len(nameEntry))}, nameEntry...)
+
+	ext := []byte{0x00, 0x00} // extension type 0 = server_name
+	ext = append(ext, byte(len(serverNameExt)>>8), byte(len(serverNameExt)))
+	ext = append(ext, serverNameExt...)
+
+	body := []byte{0x01, 0, 0, 0}               // handshake type ClientHello, length filled in below
+	body = append(body, 0x03, 0x03)             // legacy_version
+	body = append(body, make([]byte, 32)...)    // random
+	body = append(body, 0x00)                   // session_id, empty
+	body = append(body, 0x00, 0x02, 0x13, 0x01) // cipher_suites: TLS_AES_128_GCM_SHA256
+	body = append(body, 0x01, 0x00)             // compression_methods: null only
+	body = append(body, byte(len(ext)>>8), byte(len(ext)))
+	body = append(body, ext...)
+
+	msgLen := len(body) - 4
+	body[1] = byte(msgLen >> 16)
+	body[2] = byte(msgLen >> 8)
+	body[3] = byte(msgLen)
+	return body
+}
+
+// buildInitialPacket encrypts clientHello into a single CRYPTO frame and
+// wraps it in a QUIC v1 Initial packet addressed to dcid, applying AEAD
+// protection and header protection the same way extractSNI expects to undo
+// them.
+func buildInitialPacket(t *testing.T, dcid, clientHello []byte) []byte {
+	t.Helper()
+
+	key, iv, hp, err := deriveInitialSecrets(dcid)
+	if err != nil {
+		t.Fatalf("deriveInitialSecrets: %v", err)
+	}
+
+	crypto := []byte{0x06, 0x00} // CRYPTO frame, stream offset 0
+	crypto = appendVarint(crypto, uint64(len(clientHello)))
+	crypto = append(crypto, clientHello...)
+
+	const pnLen = 1
+	pn := []byte{0x00}
+
+	header := []byte{0xc0} // long header, fixed bit, Initial type, pn length - 1 = 0
+	header = binary.BigEndian.AppendUint32(header, 1)
+	header = append(header, byte(len(dcid)))
+	header = append(header, dcid...)
+	header = append(header, 0) // SCID length 0
+	header = append(header, 0) // Token length 0
+	header = appendVarint(header, uint64(pnLen+len(crypto)+16))
+	payloadOffset := len(header)
+	header = append(header, pn...)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("aes.NewCipher: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatalf("cipher.NewGCM: %v", err)
+	}
+	nonce := make([]byte, len(iv))
+	copy(nonce, iv)
+	nonce[len(nonce)-1] ^= pn[0]
+
+	ciphertext := aead.Seal(nil, nonce, crypto, header)
+	packet := append(header, ciphertext...)
+
+	hpBlock, err := aes.NewCipher(hp)
+	if err != nil {
+		t.Fatalf("aes.NewCipher(hp): %v", err)
+	}
+	sample := packet[payloadOffset+4 : payloadOffset+4+16]
+	mask := make([]byte, aes.BlockSize)
+	hpBlock.Encrypt(mask, sample)
+
+	packet[0] ^= mask[0] & 0x0f
+	for i := 0; i < pnLen; i++ {
+		packet[payloadOffset+i] ^= mask[1+i]
+	}
+
+	return packet
+}
+
+// appendVarint appends v encoded as a QUIC variable-length integer.
+func appendVarint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v))
+	case v < 1<<14:
+		return append(b, 0x40|byte(v>>8), byte(v))
+	case v < 1<<30:
+		return append(b, 0x80|byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	default:
+		return append(b, 0xc0|byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+}
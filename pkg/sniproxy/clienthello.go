@@ -0,0 +1,112 @@
+package sniproxy
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+const (
+	tlsRecordHeaderSize = 5
+	// MaxTLSRecordSize bounds the buffer peekClientHello reads into: a
+	// 5-byte record header plus the largest handshake record a compliant
+	// client will ever send.
+	MaxTLSRecordSize = 16640
+)
+
+var ErrRecordTooLarge = errors.New("TLS record exceeds maximum handshake size")
+var ErrMalformedHandshake = errors.New("ClientHello handshake message exceeds its TLS record")
+
+// helloBufPool hands out MaxTLSRecordSize buffers for peekClientHello, so a
+// busy proxy amortizes the allocation across connections instead of
+// growing a fresh buffer per connection.
+var helloBufPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, MaxTLSRecordSize)
+		return &buf
+	},
+}
+
+// helloReader replays the bytes peekClientHello consumed looking for a
+// ClientHello, then falls through to reading the raw connection. Close
+// returns the pooled buffer once the caller is done forwarding from it.
+type helloReader struct {
+	buf  *[]byte
+	data []byte
+	pos  int
+	conn io.Reader
+}
+
+func (h *helloReader) Read(p []byte) (int, error) {
+	if h.pos < len(h.data) {
+		n := copy(p, h.data[h.pos:])
+		h.pos += n
+		return n, nil
+	}
+	return h.conn.Read(p)
+}
+
+func (h *helloReader) Close() error {
+	if h.buf != nil {
+		helloBufPool.Put(h.buf)
+		h.buf = nil
+	}
+	return nil
+}
+
+// peekClientHello reads a single TLS record header, then reads exactly as
+// many bytes as the header declares into a pooled buffer sized for the
+// largest legal handshake record, instead of growing an unbounded
+// bytes.Buffer in 1 KiB steps. This bounds worst-case memory per connection
+// regardless of what size a malicious client claims. The returned reader
+// replays every byte read from conn, including on error, followed by the
+// raw connection; callers must Close it once done to return the buffer to
+// the pool.
+func (s *SNIProxy) peekClientHello(conn net.Conn) (TLSRecord, *helloReader, error) {
+	bufPtr := helloBufPool.Get().(*[]byte)
+	buf := *bufPtr
+	reader := &helloReader{buf: bufPtr, conn: conn}
+
+	header := buf[:tlsRecordHeaderSize]
+	n, err := io.ReadFull(conn, header)
+	reader.data = buf[:n]
+	if err != nil {
+		return TLSRecord{}, reader, fmt.Errorf("failed to read record header: %w", err)
+	}
+
+	if header[0] != 22 {
+		return TLSRecord{}, reader, NotTLS
+	}
+	version := binary.BigEndian.Uint16(header[1:3])
+	if version != 0x0301 && version != 0x0302 && version != 0x0303 && version != 0x0304 {
+		return TLSRecord{}, reader, NotTLS
+	}
+
+	size := int(binary.BigEndian.Uint16(header[3:5]))
+	total := tlsRecordHeaderSize + size
+	if total > len(buf) {
+		return TLSRecord{}, reader, ErrRecordTooLarge
+	}
+
+	n, err = io.ReadFull(conn, buf[tlsRecordHeaderSize:total])
+	reader.data = buf[:tlsRecordHeaderSize+n]
+	if err != nil {
+		return TLSRecord{}, reader, fmt.Errorf("failed to read record body: %w", err)
+	}
+
+	body := buf[tlsRecordHeaderSize:total]
+	if len(body) >= 4 {
+		msgLen := int(body[1])<<16 | int(body[2])<<8 | int(body[3])
+		if msgLen+4 > len(body) {
+			return TLSRecord{}, reader, ErrMalformedHandshake
+		}
+	}
+
+	return TLSRecord{
+		Header: TLSHeader{Type: 22, Version: version},
+		Body:   body,
+	}, reader, nil
+}
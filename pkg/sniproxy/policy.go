@@ -0,0 +1,114 @@
+package sniproxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/vitrevance/sniproxy/pkg/endpoints"
+)
+
+// ErrPolicyDenied is returned by a Policy when a ClientHello is rejected, so
+// callers can distinguish policy rejections from transport errors.
+var ErrPolicyDenied = errors.New("connection denied by policy")
+
+// Policy is consulted by HandleConnection after the ClientHello has been
+// parsed and before the matching backend is dialed. It may inspect the
+// client address, the parsed TLS record and the endpoint the connection
+// would be routed to, and should wrap ErrPolicyDenied when rejecting.
+type Policy interface {
+	Evaluate(remote net.Addr, record TLSRecord, ep endpoints.EndpointEntry) error
+}
+
+// brokenCipherSuites are cipher suites that offer no meaningful
+// confidentiality. They are always treated as denied regardless of
+// configuration: a ClientHello offering nothing but denied suites is
+// rejected, one that also offers an acceptable suite is not.
+var brokenCipherSuites = map[uint16]bool{
+	0x0000: true, // TLS_NULL_WITH_NULL_NULL
+	0x0001: true, // TLS_RSA_WITH_NULL_MD5
+	0x0002: true, // TLS_RSA_WITH_NULL_SHA
+	0x0004: true, // TLS_RSA_WITH_RC4_128_MD5
+	0x0005: true, // TLS_RSA_WITH_RC4_128_SHA
+	0x0017: true, // TLS_DH_anon_EXPORT_WITH_RC4_40_MD5
+	0x0019: true, // TLS_DH_anon_EXPORT_WITH_DES40_CBC_SHA
+}
+
+// DefaultPolicy rejects records below a minimum TLS version, records whose
+// cipher suites are all known-broken or listed in the endpoint's
+// DeniedCiphers, and records whose ALPN protocols are not allowed. There is
+// no cipher-suite allow-list: any offered suite outside the denied set is
+// acceptable. Each check can be overridden per endpoint via
+// EndpointEntry.MinTLSVersion / AllowedALPN / DeniedCiphers.
+type DefaultPolicy struct {
+	// MinTLSVersion is the default minimum TLSHeader.Version accepted when
+	// an endpoint does not specify its own. Zero means no minimum.
+	MinTLSVersion uint16
+}
+
+func (p DefaultPolicy) Evaluate(remote net.Addr, record TLSRecord, ep endpoints.EndpointEntry) error {
+	minVersion := p.MinTLSVersion
+	if ep.MinTLSVersion != 0 {
+		minVersion = ep.MinTLSVersion
+	}
+	if minVersion != 0 && record.Header.Version < minVersion {
+		return fmt.Errorf("%w: TLS version %#04x below minimum %#04x", ErrPolicyDenied, record.Header.Version, minVersion)
+	}
+
+	if err := checkCipherSuites(record.CipherSuites(), ep.DeniedCiphers); err != nil {
+		return err
+	}
+
+	if err := checkALPN(record.ALPN(), ep.AllowedALPN); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func checkCipherSuites(suites []uint16, denied []uint16) error {
+	if len(suites) == 0 {
+		return nil
+	}
+
+	deniedSet := brokenCipherSuites
+	if len(denied) > 0 {
+		deniedSet = make(map[uint16]bool, len(brokenCipherSuites)+len(denied))
+		for k := range brokenCipherSuites {
+			deniedSet[k] = true
+		}
+		for _, c := range denied {
+			deniedSet[c] = true
+		}
+	}
+
+	allBroken := true
+	for _, suite := range suites {
+		if !deniedSet[suite] {
+			allBroken = false
+			break
+		}
+	}
+	if allBroken {
+		return fmt.Errorf("%w: no acceptable cipher suite offered", ErrPolicyDenied)
+	}
+	return nil
+}
+
+func checkALPN(offered []string, allowed []string) error {
+	if len(allowed) == 0 || len(offered) == 0 {
+		return nil
+	}
+
+	allowedSet := make(map[string]bool, len(allowed))
+	for _, proto := range allowed {
+		allowedSet[proto] = true
+	}
+
+	for _, proto := range offered {
+		if allowedSet[proto] {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: no allowed ALPN protocol offered", ErrPolicyDenied)
+}
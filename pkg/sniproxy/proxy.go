@@ -1,7 +1,6 @@
 package sniproxy
 
 import (
-	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -10,61 +9,159 @@ import (
 	"sync"
 	"time"
 
+	"github.com/vitrevance/sniproxy/pkg/auth"
 	"github.com/vitrevance/sniproxy/pkg/endpoints"
 )
 
+// defaultHandshakeTimeout bounds how long HandleConnection waits for a
+// complete ClientHello record before giving up on a stalled peer.
+const defaultHandshakeTimeout = 60 * time.Second
+
 // SNIProxy is an SNI aware non-decrypting SNI proxy module
 type SNIProxy struct {
 	endpointsDB *endpoints.EndpointDB
+	policy      Policy
+	authorizer  auth.Authorizer
+
+	// HandshakeTimeout bounds how long a connection may take to deliver a
+	// full ClientHello record before HandleConnection aborts it.
+	HandshakeTimeout time.Duration
+
+	// RequirePreamble, when true, reads a single line from every
+	// connection before peeking the ClientHello and checks it against
+	// authorizer (which must implement auth.PreambleAuthorizer-like
+	// ReadPreamble). Leave false for listeners serving ordinary TLS
+	// clients, which never send such a preamble.
+	RequirePreamble bool
+
+	// SinkholeAddress, when set, is dialed instead of closing the
+	// connection whenever the Authorizer denies it, so a port scanner
+	// sees a live backend rather than learning that it tripped a policy.
+	SinkholeAddress string
 }
 
 // NewSNIProxy gives an new SNIProxy instance
 func NewSNIProxy(endpointsDB *endpoints.EndpointDB) *SNIProxy {
 	return &SNIProxy{
-		endpointsDB: endpointsDB,
+		endpointsDB:      endpointsDB,
+		policy:           DefaultPolicy{},
+		HandshakeTimeout: defaultHandshakeTimeout,
 	}
 }
 
+// SetPolicy replaces the Policy consulted after SNI extraction and before
+// dialing the backend. It is nil-safe: passing nil restores the default
+// DefaultPolicy{}, which has no minimum TLS version but still rejects
+// ClientHellos offering only known-broken cipher suites.
+func (s *SNIProxy) SetPolicy(policy Policy) {
+	if policy == nil {
+		policy = DefaultPolicy{}
+	}
+	s.policy = policy
+}
+
+// SetAuthorizer replaces the auth.Authorizer consulted after SNI
+// extraction and before routing to a backend. Passing nil disables
+// authorization entirely.
+func (s *SNIProxy) SetAuthorizer(authorizer auth.Authorizer) {
+	s.authorizer = authorizer
+}
+
+// preambleReader is implemented by Authorizers that expect a plaintext
+// preamble before the TLS handshake, such as auth.PreambleAuthorizer.
+type preambleReader interface {
+	ReadPreamble(conn net.Conn) error
+}
+
 func (s *SNIProxy) HandleConnection(conn net.Conn) error {
 	defer conn.Close()
 
-	if err := conn.SetReadDeadline(time.Now().Add(60 * time.Second)); err != nil {
+	if err := conn.SetReadDeadline(time.Now().Add(s.HandshakeTimeout)); err != nil {
 		return fmt.Errorf("error setting read timeout: %w", err)
 	}
 
-	domainName := ""
-	var peekedBytes *bytes.Buffer
-	{
-		sni, pb, err := s.peekClientHello(conn)
-		peekedBytes = pb
-		if err != nil {
-
-			if errors.Is(err, NotTLS) {
-				domainName = "*"
-			} else {
-				return fmt.Errorf("error reading connection: %v", err)
+	if s.RequirePreamble {
+		pr, ok := s.authorizer.(preambleReader)
+		if !ok {
+			return fmt.Errorf("RequirePreamble is set but authorizer does not support preambles")
+		}
+		if err := pr.ReadPreamble(conn); err != nil {
+			if clearErr := conn.SetReadDeadline(time.Time{}); clearErr != nil {
+				return fmt.Errorf("error removing timeout: %w", clearErr)
 			}
+			return s.deny(conn, nil, fmt.Errorf("error checking preamble: %w", err))
+		}
+	}
+
+	domainName := ""
+	var record TLSRecord
+	tls, clientReader, err := s.peekClientHello(conn)
+	defer clientReader.Close()
+	if err != nil {
+		if errors.Is(err, NotTLS) {
+			domainName = "*"
 		} else {
-			domainName = sni
+			return fmt.Errorf("error reading connection: %v", err)
 		}
+	} else {
+		record = tls
+		domainName = tls.SNI()
 	}
-	clientReader := io.MultiReader(peekedBytes, conn)
 
 	if err := conn.SetReadDeadline(time.Time{}); err != nil {
 		return fmt.Errorf("error removing timeout: %w", err)
 	}
 
+	if s.authorizer != nil {
+		if err := s.authorizer.Authorize(conn.RemoteAddr(), domainName); err != nil {
+			return s.deny(conn, clientReader, fmt.Errorf("error authorizing connection: %w", err))
+		}
+	}
+
 	ep, err := s.endpointsDB.Get(domainName)
 	if err != nil {
 		return fmt.Errorf("error routing domain %s: %w", domainName, err)
 	}
 
-	backendConn, err := net.Dial("tcp", fmt.Sprintf("%s", ep.Address))
+	if err := s.policy.Evaluate(conn.RemoteAddr(), record, ep); err != nil {
+		return err
+	}
+
+	return s.serveBackend(conn, clientReader, ep.Address, ep.SendProxyProto, record.SNI())
+}
+
+// deny reports rejectErr to the caller, unless a sinkhole backend is
+// configured, in which case the connection is silently forwarded there
+// instead of closing, so a scanner cannot distinguish a policy rejection
+// from a live but uninteresting backend. clientReader may be nil if the
+// rejection happened before the ClientHello was peeked.
+func (s *SNIProxy) deny(conn net.Conn, clientReader io.Reader, rejectErr error) error {
+	if s.SinkholeAddress == "" {
+		return rejectErr
+	}
+	if clientReader == nil {
+		clientReader = conn
+	}
+	if err := s.serveBackend(conn, clientReader, s.SinkholeAddress, endpoints.ProxyProtoOff, ""); err != nil {
+		return fmt.Errorf("%w (sinkhole also failed: %v)", rejectErr, err)
+	}
+	return nil
+}
+
+// serveBackend dials address, optionally emits a PROXY protocol header
+// describing the original client, then copies bytes bidirectionally
+// between conn and the backend until either side closes.
+func (s *SNIProxy) serveBackend(conn net.Conn, clientReader io.Reader, address string, proxyProto endpoints.ProxyProtoVersion, sni string) error {
+	backendConn, err := net.Dial("tcp", address)
 	if err != nil {
 		return fmt.Errorf("error dialing backend: %w", err)
 	}
 	defer backendConn.Close()
 
+	if err := writeProxyProtoHeader(backendConn, proxyProto, conn.RemoteAddr(), conn.LocalAddr(), sni); err != nil {
+		return fmt.Errorf("error writing proxy protocol header: %w", err)
+	}
+
 	// we make a wait group to wait for the 2-way copy to finish
 	wg := sync.WaitGroup{}
 	wg.Add(2)
@@ -95,113 +192,151 @@ type TLSRecord struct {
 	Body   []byte
 }
 
-var ReadMore = errors.New("TLS size is greater than provided buffer")
 var NotTLS = errors.New("not a TLS handshake")
 
-func (s *SNIProxy) peekClientHello(reader io.Reader) (string, *bytes.Buffer, error) {
-	peekedBytes := new(bytes.Buffer)
-
-	var err error = ReadMore
-	var tls TLSRecord
-	inBuffer := make([]byte, 1024)
-	for err != nil && errors.Is(err, ReadMore) {
-		n, readErr := reader.Read(inBuffer)
-		peekedBytes.Write(inBuffer[:n])
-		if readErr != nil && (!errors.Is(readErr, io.EOF) || !errors.Is(err, ReadMore)) {
-			return "", peekedBytes, fmt.Errorf("failed to read from connection: %w", readErr)
-		}
-		tls, err = parseTLSHandshake(peekedBytes.Bytes())
-	}
-
-	return tls.SNI(), peekedBytes, err
-}
-
-func parseTLSHandshake(buf []byte) (TLSRecord, error) {
-	if buf[0] != 22 {
-		return TLSRecord{}, NotTLS
-	}
-	version := binary.BigEndian.Uint16(buf[1:3])
-	size := binary.BigEndian.Uint16(buf[3:5])
-	if version != 0x0301 && version != 0x0302 && version != 0x0303 && version != 0x0304 {
-		return TLSRecord{}, NotTLS
-	}
-	if int(size+5) > len(buf) {
-		return TLSRecord{}, ReadMore
-	}
-	return TLSRecord{
-		Header: TLSHeader{
-			Type:    22,
-			Version: version,
-		},
-		Body: buf[5 : size+5],
-	}, nil
-}
-
-func (r *TLSRecord) SNI() string {
+// clientHello splits the handshake body into the raw cipher-suite list and
+// the raw extensions block, the two sections consulted by SNI, ALPN and
+// CipherSuites. Either return value is nil if the ClientHello is truncated
+// before that section.
+func (r *TLSRecord) clientHello() (cipherSuites []byte, extensions []byte) {
 	pos := 1 + 3 + 2 + 32
 	end := len(r.Body)
 
 	if pos > end-1 {
-		return ""
+		return nil, nil
 	}
 	sessionIdSize := int(r.Body[pos])
 	pos += 1 + sessionIdSize
 
 	if pos > end-2 {
-		return ""
+		return nil, nil
 	}
 	cipherSuiteSize := int(binary.BigEndian.Uint16(r.Body[pos : pos+2]))
-	pos += 2 + cipherSuiteSize
+	pos += 2
+	if pos+cipherSuiteSize > end {
+		return nil, nil
+	}
+	cipherSuites = r.Body[pos : pos+cipherSuiteSize]
+	pos += cipherSuiteSize
 
 	if pos > end-1 {
-		return ""
+		return cipherSuites, nil
 	}
 	compressionTypeSize := int(r.Body[pos])
 	pos += 1 + compressionTypeSize
 
 	if pos > end-2 {
-		return ""
+		return cipherSuites, nil
 	}
 	extensionsSize := int(binary.BigEndian.Uint16(r.Body[pos : pos+2]))
 	pos += 2
 
 	if pos+extensionsSize > end {
-		return ""
+		return cipherSuites, nil
 	}
-	end = pos + extensionsSize
+	extensions = r.Body[pos : pos+extensionsSize]
+	return cipherSuites, extensions
+}
 
-	for pos+4 < end {
-		extType := binary.BigEndian.Uint16(r.Body[pos : pos+2])
-		extSize := int(binary.BigEndian.Uint16(r.Body[pos+2 : pos+4]))
+// walkExtensions calls fn with the type and body of every TLS extension in
+// ext, stopping early if fn returns false.
+func walkExtensions(ext []byte, fn func(extType uint16, data []byte) bool) {
+	pos := 0
+	end := len(ext)
+	for pos+4 <= end {
+		extType := binary.BigEndian.Uint16(ext[pos : pos+2])
+		extSize := int(binary.BigEndian.Uint16(ext[pos+2 : pos+4]))
 		pos += 4
-		if extType == 0 {
-			if pos > end-2 {
-				return ""
-			}
-			namesLength := int(binary.BigEndian.Uint16(r.Body[pos : pos+2]))
-			pos += 2
-
-			// iterate over name list
-			n := pos
-			pos += namesLength
-			if pos > end {
-				return ""
-			}
-			for n < pos-3 {
-				nameType := r.Body[n]
-				nameSize := int(binary.BigEndian.Uint16(r.Body[n+1 : n+3]))
-				n += 3
-
-				if nameType == 0 {
-					if n+nameSize > end {
-						return ""
-					}
-					return string(r.Body[n : n+nameSize])
+		if pos+extSize > end {
+			return
+		}
+		if !fn(extType, ext[pos:pos+extSize]) {
+			return
+		}
+		pos += extSize
+	}
+}
+
+func (r *TLSRecord) SNI() string {
+	_, extensions := r.clientHello()
+
+	sni := ""
+	walkExtensions(extensions, func(extType uint16, data []byte) bool {
+		if extType != 0 {
+			return true
+		}
+
+		if len(data) < 2 {
+			return false
+		}
+		namesLength := int(binary.BigEndian.Uint16(data[:2]))
+		pos := 2
+		end := pos + namesLength
+		if end > len(data) {
+			return false
+		}
+
+		// iterate over name list
+		n := pos
+		for n < end-3 {
+			nameType := data[n]
+			nameSize := int(binary.BigEndian.Uint16(data[n+1 : n+3]))
+			n += 3
+
+			if nameType == 0 {
+				if n+nameSize > end {
+					return false
 				}
+				sni = string(data[n : n+nameSize])
+				return false
 			}
-		} else {
-			pos += extSize
 		}
+		return false
+	})
+	return sni
+}
+
+// ALPN returns the protocol names advertised in the application_layer_protocol_negotiation
+// extension (type 0x10), in the order the client sent them.
+func (r *TLSRecord) ALPN() []string {
+	_, extensions := r.clientHello()
+
+	var protocols []string
+	walkExtensions(extensions, func(extType uint16, data []byte) bool {
+		if extType != 0x10 {
+			return true
+		}
+		if len(data) < 2 {
+			return false
+		}
+		listLength := int(binary.BigEndian.Uint16(data[:2]))
+		pos := 2
+		end := pos + listLength
+		if end > len(data) {
+			end = len(data)
+		}
+		for pos < end {
+			size := int(data[pos])
+			pos++
+			if pos+size > end {
+				break
+			}
+			protocols = append(protocols, string(data[pos:pos+size]))
+			pos += size
+		}
+		return false
+	})
+	return protocols
+}
+
+// CipherSuites returns the cipher suites advertised by the client, in the
+// order they appear in the ClientHello.
+func (r *TLSRecord) CipherSuites() []uint16 {
+	cipherSuites, _ := r.clientHello()
+
+	suites := make([]uint16, 0, len(cipherSuites)/2)
+	for i := 0; i+1 < len(cipherSuites); i += 2 {
+		suites = append(suites, binary.BigEndian.Uint16(cipherSuites[i:i+2]))
 	}
-	return ""
+	return suites
 }
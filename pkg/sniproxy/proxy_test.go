@@ -0,0 +1,104 @@
+package sniproxy
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// failingPreambleAuthorizer always rejects the preamble, simulating a
+// client that fails the RequirePreamble check. It still consumes the
+// preamble line from conn, like auth.PreambleAuthorizer does, so it isn't
+// replayed to the sinkhole backend.
+type failingPreambleAuthorizer struct{}
+
+func (failingPreambleAuthorizer) Authorize(remote net.Addr, sni string) error { return nil }
+func (failingPreambleAuthorizer) ReadPreamble(conn net.Conn) error {
+	if _, err := bufio.NewReader(conn).ReadString('\n'); err != nil {
+		return err
+	}
+	return errors.New("invalid preamble")
+}
+
+// TestHandleConnection_SinkholeOutlivesHandshakeTimeout guards against a
+// regression where denying a RequirePreamble failure left the short
+// handshake read deadline set on the client connection, so a sinkholed
+// connection was cut off once that deadline elapsed instead of behaving
+// like an ordinary long-lived backend connection.
+func TestHandleConnection_SinkholeOutlivesHandshakeTimeout(t *testing.T) {
+	backendLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen backend: %v", err)
+	}
+	defer backendLn.Close()
+	go func() {
+		conn, err := backendLn.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// Echo everything back, like an ordinary service would.
+		buf := make([]byte, 4096)
+		for {
+			n, err := conn.Read(buf)
+			if n > 0 {
+				if _, err := conn.Write(buf[:n]); err != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	proxy := NewSNIProxy(nil)
+	proxy.HandshakeTimeout = 50 * time.Millisecond
+	proxy.RequirePreamble = true
+	proxy.SinkholeAddress = backendLn.Addr().String()
+	proxy.SetAuthorizer(failingPreambleAuthorizer{})
+
+	proxyLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen proxy: %v", err)
+	}
+	defer proxyLn.Close()
+	go func() {
+		conn, err := proxyLn.Accept()
+		if err != nil {
+			return
+		}
+		proxy.HandleConnection(conn)
+	}()
+
+	client, err := net.Dial("tcp", proxyLn.Addr().String())
+	if err != nil {
+		t.Fatalf("dial proxy: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.Write([]byte("not the secret\n")); err != nil {
+		t.Fatalf("write preamble: %v", err)
+	}
+
+	// Wait well past HandshakeTimeout before exchanging any more data. If
+	// the read deadline set for the preamble/ClientHello peek was never
+	// cleared before handing off to the sinkhole, the connection would
+	// already be closed by now.
+	time.Sleep(5 * proxy.HandshakeTimeout)
+
+	if _, err := client.Write([]byte("still alive\n")); err != nil {
+		t.Fatalf("write after timeout window: %v", err)
+	}
+
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	line, err := bufio.NewReader(client).ReadString('\n')
+	if err != nil {
+		t.Fatalf("sinkhole connection did not survive past HandshakeTimeout: %v", err)
+	}
+	if line != "still alive\n" {
+		t.Errorf("got %q, want %q", line, "still alive\n")
+	}
+}
@@ -0,0 +1,106 @@
+package sniproxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/vitrevance/sniproxy/pkg/endpoints"
+)
+
+// proxyProtoV2Signature is the fixed 12-byte signature every PROXY protocol
+// v2 header starts with.
+var proxyProtoV2Signature = []byte{
+	0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A,
+}
+
+// proxyProtoTLVSNI is a vendor-specific TLV type (the 0xE0-0xEF range is
+// reserved for custom use by RFC/HAProxy spec) carrying the SNI the proxy
+// matched, so the backend can log it without re-parsing the ClientHello.
+const proxyProtoTLVSNI = 0xE0
+
+// writeProxyProtoHeader writes a PROXY protocol header describing client ->
+// backend to w, ahead of the first byte of client data, so the backend can
+// recover the real client address. sni may be empty.
+func writeProxyProtoHeader(w interface{ Write([]byte) (int, error) }, version endpoints.ProxyProtoVersion, client, dst net.Addr, sni string) error {
+	switch version {
+	case endpoints.ProxyProtoOff, "":
+		return nil
+	case endpoints.ProxyProtoV1:
+		header, err := buildProxyProtoV1(client, dst)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(header)
+		return err
+	case endpoints.ProxyProtoV2:
+		header, err := buildProxyProtoV2(client, dst, sni)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(header)
+		return err
+	default:
+		return fmt.Errorf("unknown proxy protocol version %q", version)
+	}
+}
+
+func buildProxyProtoV1(client, dst net.Addr) ([]byte, error) {
+	clientTCP, ok := client.(*net.TCPAddr)
+	if !ok {
+		return nil, fmt.Errorf("proxy protocol v1 requires a TCP client address, got %T", client)
+	}
+	dstTCP, ok := dst.(*net.TCPAddr)
+	if !ok {
+		return nil, fmt.Errorf("proxy protocol v1 requires a TCP destination address, got %T", dst)
+	}
+
+	family := "TCP4"
+	if clientTCP.IP.To4() == nil {
+		family = "TCP6"
+	}
+
+	return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n",
+		family, clientTCP.IP.String(), dstTCP.IP.String(), clientTCP.Port, dstTCP.Port)), nil
+}
+
+func buildProxyProtoV2(client, dst net.Addr, sni string) ([]byte, error) {
+	clientTCP, ok := client.(*net.TCPAddr)
+	if !ok {
+		return nil, fmt.Errorf("proxy protocol v2 requires a TCP client address, got %T", client)
+	}
+	dstTCP, ok := dst.(*net.TCPAddr)
+	if !ok {
+		return nil, fmt.Errorf("proxy protocol v2 requires a TCP destination address, got %T", dst)
+	}
+
+	var addrBuf bytes.Buffer
+	var addressFamily byte
+	if clientIP4 := clientTCP.IP.To4(); clientIP4 != nil {
+		addressFamily = 0x11 // AF_INET << 4 | STREAM
+		addrBuf.Write(clientIP4)
+		addrBuf.Write(dstTCP.IP.To4())
+	} else {
+		addressFamily = 0x21 // AF_INET6 << 4 | STREAM
+		addrBuf.Write(clientTCP.IP.To16())
+		addrBuf.Write(dstTCP.IP.To16())
+	}
+	binary.Write(&addrBuf, binary.BigEndian, uint16(clientTCP.Port))
+	binary.Write(&addrBuf, binary.BigEndian, uint16(dstTCP.Port))
+
+	if sni != "" {
+		addrBuf.WriteByte(proxyProtoTLVSNI)
+		binary.Write(&addrBuf, binary.BigEndian, uint16(len(sni)))
+		addrBuf.WriteString(sni)
+	}
+
+	var header bytes.Buffer
+	header.Write(proxyProtoV2Signature)
+	header.WriteByte(0x21) // version 2, command PROXY
+	header.WriteByte(addressFamily)
+	binary.Write(&header, binary.BigEndian, uint16(addrBuf.Len()))
+	header.Write(addrBuf.Bytes())
+
+	return header.Bytes(), nil
+}
@@ -0,0 +1,84 @@
+package sniproxy
+
+import (
+	"net"
+	"testing"
+)
+
+func TestBuildProxyProtoV1(t *testing.T) {
+	client := &net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 56324}
+	dst := &net.TCPAddr{IP: net.ParseIP("192.168.0.11"), Port: 443}
+
+	header, err := buildProxyProtoV1(client, dst)
+	if err != nil {
+		t.Fatalf("buildProxyProtoV1: %v", err)
+	}
+
+	want := "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"
+	if string(header) != want {
+		t.Errorf("got %q, want %q", header, want)
+	}
+}
+
+func TestBuildProxyProtoV1_TCP6(t *testing.T) {
+	client := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 56324}
+	dst := &net.TCPAddr{IP: net.ParseIP("2001:db8::11"), Port: 443}
+
+	header, err := buildProxyProtoV1(client, dst)
+	if err != nil {
+		t.Fatalf("buildProxyProtoV1: %v", err)
+	}
+
+	want := "PROXY TCP6 2001:db8::1 2001:db8::11 56324 443\r\n"
+	if string(header) != want {
+		t.Errorf("got %q, want %q", header, want)
+	}
+}
+
+func TestBuildProxyProtoV2(t *testing.T) {
+	client := &net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 56324}
+	dst := &net.TCPAddr{IP: net.ParseIP("192.168.0.11"), Port: 443}
+
+	header, err := buildProxyProtoV2(client, dst, "")
+	if err != nil {
+		t.Fatalf("buildProxyProtoV2: %v", err)
+	}
+
+	want := []byte{
+		0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A, // signature
+		0x21,       // version 2, command PROXY
+		0x11,       // AF_INET, STREAM
+		0x00, 0x0C, // length = 12 (4+4+2+2)
+		192, 168, 0, 1,
+		192, 168, 0, 11,
+		0xDC, 0x04, // 56324
+		0x01, 0xBB, // 443
+	}
+
+	if string(header) != string(want) {
+		t.Errorf("got %x, want %x", header, want)
+	}
+}
+
+func TestBuildProxyProtoV2_WithSNITLV(t *testing.T) {
+	client := &net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 56324}
+	dst := &net.TCPAddr{IP: net.ParseIP("192.168.0.11"), Port: 443}
+
+	header, err := buildProxyProtoV2(client, dst, "example.com")
+	if err != nil {
+		t.Fatalf("buildProxyProtoV2: %v", err)
+	}
+
+	wantLen := 12 + 1 + 1 + 2 + 12 + 3 + len("example.com")
+	if len(header) != wantLen {
+		t.Fatalf("got length %d, want %d", len(header), wantLen)
+	}
+
+	tlv := header[len(header)-3-len("example.com"):]
+	if tlv[0] != proxyProtoTLVSNI {
+		t.Errorf("got TLV type %#x, want %#x", tlv[0], proxyProtoTLVSNI)
+	}
+	if string(tlv[3:]) != "example.com" {
+		t.Errorf("got TLV value %q, want %q", tlv[3:], "example.com")
+	}
+}